@@ -8,20 +8,182 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
 	containerdshim "github.com/kata-containers/kata-containers/src/runtime/pkg/containerd-shim-v2"
+	"github.com/kata-containers/kata-containers/src/runtime/pkg/device/config"
 	"github.com/kata-containers/kata-containers/src/runtime/pkg/katautils"
 	"github.com/kata-containers/kata-containers/src/runtime/pkg/utils/shimclient"
 	"github.com/urfave/cli"
 )
 
 var (
-	devPath string
+	devPath      string
+	devType      string
+	devMajor     string
+	devMinor     string
+	devAccess    string
+	devAllow     bool
+	devDriver    string
+	devTransient bool
 )
 
+var deviceRuleFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:        "type",
+		Usage:       `the device cgroup rule type: "a" (all), "b" (block) or "c" (char)`,
+		Destination: &devType,
+	},
+	cli.StringFlag{
+		Name:        "major",
+		Usage:       "the device major number, omit or pass \"*\" to match any major",
+		Destination: &devMajor,
+	},
+	cli.StringFlag{
+		Name:        "minor",
+		Usage:       "the device minor number, omit or pass \"*\" to match any minor",
+		Destination: &devMinor,
+	},
+	cli.StringFlag{
+		Name:        "access",
+		Usage:       "the cgroup access permissions to grant or deny, e.g. \"rwm\"",
+		Destination: &devAccess,
+	},
+	cli.BoolTFlag{
+		Name:        "allow",
+		Usage:       "allow (the default) or, with --allow=false, deny access to the rule",
+		Destination: &devAllow,
+	},
+}
+
+// deviceRuleFromFlags builds a katautils.DeviceRule from the --type,
+// --major, --minor and --access flags. It returns nil when none of them
+// were set, meaning the caller only intends to operate on --device-path.
+// --device-path and the cgroup rule flags are mutually exclusive: mixing
+// them would leave it ambiguous whether the caller wanted a concrete
+// device attach or a permission-only rule, so this rejects the request
+// instead of silently sending both.
+func deviceRuleFromFlags() (*katautils.DeviceRule, error) {
+	if devType == "" && devMajor == "" && devMinor == "" && devAccess == "" {
+		return nil, nil
+	}
+
+	if devPath != "" {
+		return nil, fmt.Errorf("--device-path cannot be combined with --type/--major/--minor/--access")
+	}
+
+	if devType == "" {
+		return nil, fmt.Errorf("--type is required when specifying a device cgroup rule")
+	}
+
+	major, err := parseDeviceNumber(devMajor)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --major: %w", err)
+	}
+
+	minor, err := parseDeviceNumber(devMinor)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --minor: %w", err)
+	}
+
+	return &katautils.DeviceRule{
+		Type:        devType,
+		Major:       major,
+		Minor:       minor,
+		Permissions: devAccess,
+		Allow:       devAllow,
+	}, nil
+}
+
+// parseDeviceNumber parses a major or minor cgroup rule number. An empty
+// string or "*" means "any", represented as a nil pointer.
+func parseDeviceNumber(s string) (*int64, error) {
+	if s == "" || s == "*" {
+		return nil, nil
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	return &n, nil
+}
+
+// persistDeviceAttach records a successful attach in the sandbox's durable
+// device store so `kata-runtime device reconcile` can re-attach it later
+// if it goes missing (e.g. a shim restart or a guest suspend/resume),
+// unless the caller passed --transient. A rule-based attach is recorded
+// as given; a path-based attach is resolved to its concrete device
+// node(s) first, so a directory attach yields one record per device
+// beneath it. driver, when set, is the host driver a VFIO/PCI device was
+// bound to (--driver) and must be carried into the record so a later
+// reconcile rebinds it the same way.
+func persistDeviceAttach(sandboxID, devPath string, rule *katautils.DeviceRule, access, driver string) error {
+	attachedAt := time.Now()
+
+	if rule != nil {
+		return katautils.AddDeviceRecord(sandboxID, katautils.DeviceRecord{
+			Rule:        rule,
+			Permissions: access,
+			AttachedAt:  attachedAt,
+		})
+	}
+
+	devices, err := katautils.GetDeviceInfoByPath(devPath)
+	if err != nil {
+		return err
+	}
+
+	for _, dev := range devices {
+		recordDriver := driver
+		if recordDriver == "" {
+			recordDriver = dev.Driver
+		}
+
+		if err := katautils.AddDeviceRecord(sandboxID, katautils.DeviceRecord{
+			DevicePath:  dev.ContainerPath,
+			Major:       dev.Major,
+			Minor:       dev.Minor,
+			Driver:      recordDriver,
+			Permissions: access,
+			AttachedAt:  attachedAt,
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// forgetDeviceAttach removes the durable record(s) created by a matching
+// persistDeviceAttach, mirroring its path-vs-rule resolution.
+func forgetDeviceAttach(sandboxID, devPath string, rule *katautils.DeviceRule) error {
+	if rule != nil {
+		return katautils.RemoveDeviceRecord(sandboxID, "", rule)
+	}
+
+	devices, err := katautils.GetDeviceInfoByPath(devPath)
+	if err != nil {
+		return err
+	}
+
+	for _, dev := range devices {
+		if err := katautils.RemoveDeviceRecord(sandboxID, dev.ContainerPath, nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 var deviceSubCmds = []cli.Command{
 	listDeviceCommand,
 	attachDeviceCommand,
 	detachDeviceCOmmand,
+	reconcileDeviceCommand,
 }
 
 var kataDeviceCommand = cli.Command{
@@ -33,6 +195,38 @@ var kataDeviceCommand = cli.Command{
 	},
 }
 
+// devicePathOrUnderPath reports whether path is candidate itself or a
+// path beneath the candidate directory, mirroring the directory
+// semantics GetDeviceInfoByPath uses for an attach.
+func devicePathOrUnderPath(path, candidate string) bool {
+	return path == candidate || strings.HasPrefix(path, candidate+"/")
+}
+
+// filterDevicesByPath keeps only the devices whose ContainerPath is
+// devPath itself or lies beneath it.
+func filterDevicesByPath(devices []config.DeviceInfo, devPath string) []config.DeviceInfo {
+	var filtered []config.DeviceInfo
+	for _, dev := range devices {
+		if devicePathOrUnderPath(dev.ContainerPath, devPath) {
+			filtered = append(filtered, dev)
+		}
+	}
+	return filtered
+}
+
+// filterRecordsByPath keeps only the persisted records whose DevicePath
+// is devPath itself or lies beneath it; rule-based records, which have
+// no DevicePath, never match a path filter.
+func filterRecordsByPath(records []katautils.DeviceRecord, devPath string) []katautils.DeviceRecord {
+	var filtered []katautils.DeviceRecord
+	for _, record := range records {
+		if record.DevicePath != "" && devicePathOrUnderPath(record.DevicePath, devPath) {
+			filtered = append(filtered, record)
+		}
+	}
+	return filtered
+}
+
 var listDeviceCommand = cli.Command{
 	Name:  "list",
 	Usage: "list all assigned device",
@@ -45,7 +239,7 @@ var listDeviceCommand = cli.Command{
 		},
 		cli.StringFlag{
 			Name:        "device-path",
-			Usage:       "the absolute path of device",
+			Usage:       "only list devices and records at, or beneath, this absolute device or directory path",
 			Destination: &devPath,
 		},
 	},
@@ -55,14 +249,42 @@ var listDeviceCommand = cli.Command{
 			return err
 		}
 
-		url := containerdshim.DeviceUrl
+		body, err := shimclient.DoGet(sandboxID, defaultTimeout, containerdshim.DeviceUrl)
+		if err != nil {
+			return err
+		}
+
+		var live containerdshim.DeviceResponse
+		if err := json.Unmarshal(body, &live); err != nil {
+			return fmt.Errorf("error parsing live device list: %w", err)
+		}
+
+		records, err := katautils.LoadDeviceRecords(sandboxID)
+		if err != nil {
+			return err
+		}
+
+		if devPath != "" {
+			live.Devices = filterDevicesByPath(live.Devices, devPath)
+			records = filterRecordsByPath(records, devPath)
+		}
 
-		body, err := shimclient.DoGet(sandboxID, defaultTimeout, url)
+		encoded, err := json.MarshalIndent(live, "", "  ")
 		if err != nil {
 			return err
 		}
+		fmt.Println(string(encoded))
+
+		if len(records) > 0 {
+			encoded, err := json.MarshalIndent(records, "", "  ")
+			if err != nil {
+				return err
+			}
+
+			fmt.Println("persisted device records:")
+			fmt.Println(string(encoded))
+		}
 
-		fmt.Println(string(body))
 		return nil
 	},
 }
@@ -70,7 +292,7 @@ var listDeviceCommand = cli.Command{
 var attachDeviceCommand = cli.Command{
 	Name:  "attach",
 	Usage: "attach the device to sandbox",
-	Flags: []cli.Flag{
+	Flags: append([]cli.Flag{
 		cli.StringFlag{
 			Name:        "sandbox-id",
 			Usage:       "the target sandbox for getting the iptables",
@@ -79,32 +301,58 @@ var attachDeviceCommand = cli.Command{
 		},
 		cli.StringFlag{
 			Name:        "device-path",
-			Usage:       "the absolute path of device",
+			Usage:       "the absolute path of a device or directory, a VFIO group (/dev/vfio/<group>), or a PCI device's sysfs path (/sys/bus/pci/devices/<bdf>)",
 			Destination: &devPath,
 		},
-	},
+		cli.StringFlag{
+			Name:        "driver",
+			Usage:       "for a VFIO/PCI device, bind it to this driver (e.g. \"vfio-pci\") before attaching it",
+			Destination: &devDriver,
+		},
+		cli.BoolFlag{
+			Name:        "transient",
+			Usage:       "do not persist this attach; `device reconcile` will never re-attach it",
+			Destination: &devTransient,
+		},
+	}, deviceRuleFlags...),
 	Action: func(c *cli.Context) error {
 		// verify sandbox exists:
 		if err := katautils.VerifyContainerID(sandboxID); err != nil {
 			return err
 		}
 
+		rule, err := deviceRuleFromFlags()
+		if err != nil {
+			return err
+		}
+
 		resizeReq := containerdshim.DeviceRequest{
 			DevicePath: devPath,
+			Driver:     devDriver,
+			Rule:       rule,
+			Transient:  devTransient,
 		}
 		encoded, err := json.Marshal(resizeReq)
 		if err != nil {
 			return err
 		}
 
-		return shimclient.DoPut(sandboxID, defaultTimeout*10, containerdshim.DeviceUrl, "application/json", encoded)
+		if err := shimclient.DoPut(sandboxID, defaultTimeout*10, containerdshim.DeviceUrl, "application/json", encoded); err != nil {
+			return err
+		}
+
+		if devTransient {
+			return nil
+		}
+
+		return persistDeviceAttach(sandboxID, devPath, rule, devAccess, devDriver)
 	},
 }
 
 var detachDeviceCOmmand = cli.Command{
 	Name:  "detach",
 	Usage: "detach the device from sandbox",
-	Flags: []cli.Flag{
+	Flags: append([]cli.Flag{
 		cli.StringFlag{
 			Name:        "sandbox-id",
 			Usage:       "the target sandbox for getting the iptables",
@@ -113,24 +361,91 @@ var detachDeviceCOmmand = cli.Command{
 		},
 		cli.StringFlag{
 			Name:        "device-path",
-			Usage:       "the absolute path of device",
+			Usage:       "the absolute path of a device or directory, a VFIO group (/dev/vfio/<group>), or a PCI device's sysfs path (/sys/bus/pci/devices/<bdf>)",
 			Destination: &devPath,
 		},
-	},
+	}, deviceRuleFlags...),
 	Action: func(c *cli.Context) error {
 		// verify sandbox exists:
 		if err := katautils.VerifyContainerID(sandboxID); err != nil {
 			return err
 		}
 
+		rule, err := deviceRuleFromFlags()
+		if err != nil {
+			return err
+		}
+
 		resizeReq := containerdshim.DeviceRequest{
 			DevicePath: devPath,
+			Rule:       rule,
 		}
 		encoded, err := json.Marshal(resizeReq)
 		if err != nil {
 			return err
 		}
 
-		return shimclient.DoDelete(sandboxID, defaultTimeout*10, containerdshim.DeviceUrl, "application/json", encoded)
+		if err := shimclient.DoDelete(sandboxID, defaultTimeout*10, containerdshim.DeviceUrl, "application/json", encoded); err != nil {
+			return err
+		}
+
+		return forgetDeviceAttach(sandboxID, devPath, rule)
+	},
+}
+
+var reconcileDeviceCommand = cli.Command{
+	Name:  "reconcile",
+	Usage: "diff persisted device records against the sandbox's live devices and re-attach anything missing",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:        "sandbox-id",
+			Usage:       "the target sandbox to reconcile",
+			Required:    true,
+			Destination: &sandboxID,
+		},
+	},
+	Action: func(c *cli.Context) error {
+		// verify sandbox exists:
+		if err := katautils.VerifyContainerID(sandboxID); err != nil {
+			return err
+		}
+
+		body, err := shimclient.DoGet(sandboxID, defaultTimeout, containerdshim.DeviceUrl)
+		if err != nil {
+			return err
+		}
+
+		var live containerdshim.DeviceResponse
+		if err := json.Unmarshal(body, &live); err != nil {
+			return fmt.Errorf("error parsing live device list: %w", err)
+		}
+
+		replayed, err := containerdshim.ReplayDevicesAtSandboxStart(sandboxID, live, func(record katautils.DeviceRecord) error {
+			resizeReq := containerdshim.DeviceRequest{
+				DevicePath: record.DevicePath,
+				Driver:     record.Driver,
+				Rule:       record.Rule,
+			}
+			encoded, err := json.Marshal(resizeReq)
+			if err != nil {
+				return err
+			}
+
+			if err := shimclient.DoPut(sandboxID, defaultTimeout*10, containerdshim.DeviceUrl, "application/json", encoded); err != nil {
+				return fmt.Errorf("error re-attaching %s: %w", record.DevicePath, err)
+			}
+
+			fmt.Printf("re-attached %s\n", record.DevicePath)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		if len(replayed) == 0 {
+			fmt.Println("no drift detected: every persisted device is attached")
+		}
+
+		return nil
 	},
 }
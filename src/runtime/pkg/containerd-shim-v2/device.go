@@ -0,0 +1,69 @@
+// Copyright (c) 2023 Kata Contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package containerdshim
+
+import (
+	"github.com/kata-containers/kata-containers/src/runtime/pkg/device/config"
+	"github.com/kata-containers/kata-containers/src/runtime/pkg/katautils"
+)
+
+// DeviceUrl is the management API endpoint used by `kata-runtime device`
+// to list, attach and detach devices from a running sandbox.
+const DeviceUrl = "/device"
+
+// DeviceRequest is the body sent to DeviceUrl to attach or detach one or
+// more devices. DevicePath names a device node, a VFIO group
+// (/dev/vfio/<group>) or a PCI device's sysfs path
+// (/sys/bus/pci/devices/<bdf>), or, to hot-plug an entire subtree (e.g.
+// /dev/dri) in one call, a directory containing device nodes. Rule, when
+// set, instead describes an OCI-style device cgroup rule (e.g.
+// "c 226:* rwm") that the shim programs into the guest cgroup without
+// requiring the caller to know the backing host path. Driver, relevant
+// only to VFIO/PCI devices, overrides the host driver the device is
+// bound to before it is handed to the VFIO device manager. Transient
+// opts an attach out of the durable device store, so `device reconcile`
+// never reports it as drift and never re-attaches it on the caller's
+// behalf.
+type DeviceRequest struct {
+	DevicePath string                `json:"device-path,omitempty"`
+	Driver     string                `json:"driver,omitempty"`
+	Rule       *katautils.DeviceRule `json:"rule,omitempty"`
+	Transient  bool                  `json:"transient,omitempty"`
+}
+
+// DeviceResponse is returned by the list and attach endpoints. Devices
+// reports every device node resolved from the request, which covers more
+// than one entry when DevicePath named a directory. Rules reports every
+// device cgroup rule currently programmed into the guest, independent of
+// Devices: a rule-only attach (e.g. "c 226:* rwm" with no concrete host
+// path) has no entry in Devices and is only visible here. Records
+// additionally reports every device persisted to the sandbox's durable
+// device store, regardless of whether it is currently live in the
+// guest; comparing Records against Devices and Rules is what lets a
+// caller notice drift after a suspend/resume or a shim restart.
+type DeviceResponse struct {
+	Devices []config.DeviceInfo      `json:"devices"`
+	Rules   []katautils.DeviceRule   `json:"rules,omitempty"`
+	Records []katautils.DeviceRecord `json:"records,omitempty"`
+}
+
+// ReplayDevicesAtSandboxStart re-attaches every device record persisted
+// for sandboxID that is missing from live, calling attach once per
+// missing record. It is the hook a sandbox's create/restart path should
+// call as soon as the sandbox's live device state (live.Devices,
+// live.Rules) is known, so a device lost across a shim restart or guest
+// suspend/resume comes back without an operator having to run
+// `kata-runtime device reconcile` by hand.
+//
+// The only caller in this tree is the `kata-runtime device reconcile`
+// subcommand: this package holds the device management API's wire types
+// (DeviceRequest, DeviceResponse) but not the sandbox lifecycle code —
+// the shim service's Create/Start handlers — so no sandbox create or
+// restart calls it, and device-record replay happens only when
+// reconcile is run.
+func ReplayDevicesAtSandboxStart(sandboxID string, live DeviceResponse, attach func(katautils.DeviceRecord) error) ([]katautils.DeviceRecord, error) {
+	return katautils.ReplayDeviceRecords(sandboxID, live.Devices, live.Rules, attach)
+}
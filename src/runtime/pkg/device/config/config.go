@@ -0,0 +1,49 @@
+// Copyright (c) 2018 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package config
+
+import "os"
+
+// DeviceInfo describes a device to be hot-plugged into, or already
+// attached to, a running sandbox.
+type DeviceInfo struct {
+	// ContainerPath is the path used to refer to the device within the
+	// container. For a block/char/fifo node this is the path to the
+	// node itself; for a VFIO or PCI device it is the sysfs/devfs path
+	// the device was resolved from.
+	ContainerPath string `json:"container-path"`
+
+	// DevType is the device type: "b", "c"/"u" or "p" for a concrete
+	// device node, or "vfio"/"pci" for VFIO-mediated passthrough.
+	DevType string `json:"dev-type"`
+
+	Major int64 `json:"major"`
+	Minor int64 `json:"minor"`
+
+	UID uint32 `json:"uid"`
+	GID uint32 `json:"gid"`
+
+	FileMode os.FileMode `json:"file-mode"`
+
+	// IOMMUGroup is the host IOMMU group a VFIO device belongs to.
+	// Only set when DevType is "vfio" or "pci".
+	IOMMUGroup string `json:"iommu-group,omitempty"`
+
+	// BDF is the PCI bus:device.function address of the device, e.g.
+	// "0000:03:00.0". Only set when DevType is "vfio" or "pci".
+	BDF string `json:"bdf,omitempty"`
+
+	// VendorID and DeviceID are the PCI vendor and device IDs read from
+	// sysfs, e.g. "10de" and "1eb8". Only set when DevType is "vfio" or
+	// "pci".
+	VendorID string `json:"vendor-id,omitempty"`
+	DeviceID string `json:"device-id,omitempty"`
+
+	// Driver is the host driver the device is currently bound to, read
+	// from its sysfs driver link (e.g. "vfio-pci"). Empty when no driver
+	// is bound.
+	Driver string `json:"driver,omitempty"`
+}
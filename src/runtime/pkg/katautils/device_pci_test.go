@@ -0,0 +1,149 @@
+// Copyright (c) 2023 Kata Contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package katautils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVFIOGroupRegex(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{path: "/dev/vfio/42", want: true},
+		{path: "/dev/vfio/0", want: true},
+		{path: "/dev/vfio/vfio", want: false},
+		{path: "/dev/vfio/42/", want: false},
+		{path: "/dev/vfio/42/sub", want: false},
+		{path: "/dev/vfio", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := vfioGroupRegex.MatchString(tt.path); got != tt.want {
+				t.Errorf("vfioGroupRegex.MatchString(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPCIAddressRegex(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{path: "/sys/bus/pci/devices/0000:03:00.0", want: true},
+		{path: "/sys/bus/pci/devices/0000:03:00.7", want: true},
+		{path: "/sys/bus/pci/devices/0000:03:00.0/", want: false},
+		{path: "/sys/bus/pci/devices/0000:03:00.g", want: false},
+		{path: "/sys/bus/pci/devices/0000:03:00", want: false},
+		{path: "/sys/bus/pci/devices/0000:03:00.00", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := pciAddressRegex.MatchString(tt.path); got != tt.want {
+				t.Errorf("pciAddressRegex.MatchString(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+// newPCISysfsFixture builds a temp directory shaped like a PCI device's
+// sysfs directory, with vendor/device ID files and driver/iommu_group
+// symlinks, the way the real sysfs directory is laid out.
+func newPCISysfsFixture(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(dir, "vendor"), []byte("0x10de\n"), 0600); err != nil {
+		t.Fatalf("failed to write vendor file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "device"), []byte("0x1eb8\n"), 0600); err != nil {
+		t.Fatalf("failed to write device file: %v", err)
+	}
+
+	driverTarget := filepath.Join(t.TempDir(), "vfio-pci")
+	if err := os.Mkdir(driverTarget, 0700); err != nil {
+		t.Fatalf("failed to create driver target: %v", err)
+	}
+	if err := os.Symlink(driverTarget, filepath.Join(dir, "driver")); err != nil {
+		t.Fatalf("failed to symlink driver: %v", err)
+	}
+
+	groupTarget := filepath.Join(t.TempDir(), "42")
+	if err := os.Mkdir(groupTarget, 0700); err != nil {
+		t.Fatalf("failed to create iommu_group target: %v", err)
+	}
+	if err := os.Symlink(groupTarget, filepath.Join(dir, "iommu_group")); err != nil {
+		t.Fatalf("failed to symlink iommu_group: %v", err)
+	}
+
+	return dir
+}
+
+func TestDeviceFromPCIPath(t *testing.T) {
+	dir := newPCISysfsFixture(t)
+
+	dev, err := deviceFromPCIPath(dir, "0000:03:00.0")
+	if err != nil {
+		t.Fatalf("deviceFromPCIPath() error = %v", err)
+	}
+
+	if dev.DevType != pciDevice {
+		t.Errorf("DevType = %q, want %q", dev.DevType, pciDevice)
+	}
+	if dev.BDF != "0000:03:00.0" {
+		t.Errorf("BDF = %q, want %q", dev.BDF, "0000:03:00.0")
+	}
+	if dev.VendorID != "10de" {
+		t.Errorf("VendorID = %q, want %q", dev.VendorID, "10de")
+	}
+	if dev.DeviceID != "1eb8" {
+		t.Errorf("DeviceID = %q, want %q", dev.DeviceID, "1eb8")
+	}
+	if dev.Driver != "vfio-pci" {
+		t.Errorf("Driver = %q, want %q", dev.Driver, "vfio-pci")
+	}
+	if dev.IOMMUGroup != "42" {
+		t.Errorf("IOMMUGroup = %q, want %q", dev.IOMMUGroup, "42")
+	}
+}
+
+func TestDeviceFromPCIPathMissingDriverAndIOMMUGroupAreOptional(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(dir, "vendor"), []byte("0x10de"), 0600); err != nil {
+		t.Fatalf("failed to write vendor file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "device"), []byte("0x1eb8"), 0600); err != nil {
+		t.Fatalf("failed to write device file: %v", err)
+	}
+
+	dev, err := deviceFromPCIPath(dir, "0000:03:00.0")
+	if err != nil {
+		t.Fatalf("deviceFromPCIPath() error = %v", err)
+	}
+
+	if dev.Driver != "" {
+		t.Errorf("Driver = %q, want empty when unbound", dev.Driver)
+	}
+	if dev.IOMMUGroup != "" {
+		t.Errorf("IOMMUGroup = %q, want empty when no iommu_group symlink exists", dev.IOMMUGroup)
+	}
+}
+
+func TestDeviceFromPCIPathMissingVendorFileIsAnError(t *testing.T) {
+	dir := t.TempDir()
+
+	if _, err := deviceFromPCIPath(dir, "0000:03:00.0"); err == nil {
+		t.Error("deviceFromPCIPath() error = nil, want an error when the vendor file is missing")
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright (c) 2023 Kata Contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package katautils
+
+import (
+	"testing"
+
+	"github.com/kata-containers/kata-containers/src/runtime/pkg/device/config"
+)
+
+func int64Ptr(n int64) *int64 {
+	return &n
+}
+
+func TestDeviceRuleMatches(t *testing.T) {
+	tests := []struct {
+		name string
+		rule DeviceRule
+		dev  config.DeviceInfo
+		want bool
+	}{
+		{
+			name: "wildcard type matches any device type",
+			rule: DeviceRule{Type: wildcardDevice},
+			dev:  config.DeviceInfo{DevType: charDevice, Major: 226, Minor: 0},
+			want: true,
+		},
+		{
+			name: "mismatched type does not match",
+			rule: DeviceRule{Type: blockDevice},
+			dev:  config.DeviceInfo{DevType: charDevice},
+			want: false,
+		},
+		{
+			name: "nil major and minor match any device of the same type",
+			rule: DeviceRule{Type: charDevice},
+			dev:  config.DeviceInfo{DevType: charDevice, Major: 226, Minor: 128},
+			want: true,
+		},
+		{
+			name: "specific major must match",
+			rule: DeviceRule{Type: charDevice, Major: int64Ptr(226)},
+			dev:  config.DeviceInfo{DevType: charDevice, Major: 1, Minor: 3},
+			want: false,
+		},
+		{
+			name: "specific major and wildcard minor",
+			rule: DeviceRule{Type: charDevice, Major: int64Ptr(226)},
+			dev:  config.DeviceInfo{DevType: charDevice, Major: 226, Minor: 7},
+			want: true,
+		},
+		{
+			name: "specific major and minor must both match",
+			rule: DeviceRule{Type: charDevice, Major: int64Ptr(226), Minor: int64Ptr(0)},
+			dev:  config.DeviceInfo{DevType: charDevice, Major: 226, Minor: 1},
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rule.Matches(tt.dev); got != tt.want {
+				t.Errorf("DeviceRule.Matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
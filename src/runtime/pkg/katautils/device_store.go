@@ -0,0 +1,228 @@
+// Copyright (c) 2023 Kata Contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package katautils
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/kata-containers/kata-containers/src/runtime/pkg/device/config"
+)
+
+// sandboxStateDirRoot is where sandbox state, including the persisted
+// device store, is kept. A var, not a const, so tests can point it at a
+// temp directory instead of writing into /run/vc/sbs.
+var sandboxStateDirRoot = "/run/vc/sbs"
+
+// deviceStoreFile is the name of the persisted device record file kept
+// alongside the rest of a sandbox's state.
+const deviceStoreFile = "devices.json"
+
+// DeviceRecord is a single persisted device attach, either a concrete
+// device path or an OCI device cgroup rule, along with the major/minor
+// resolved at attach time and when the attach happened. Records outlive
+// the shim process; ReplayDeviceRecords compares them against what a
+// sandbox actually has attached and re-attaches whatever's missing.
+//
+// This package has no sandbox-start or sandbox-create code path of its
+// own to call ReplayDeviceRecords from. containerdshim.ReplayDevicesAtSandboxStart
+// wraps it as the hook a sandbox's create/restart path should call, but
+// this tree has no such path to call it either, so today the only
+// caller of either function is the `kata-runtime device reconcile`
+// subcommand, run by hand (or from an external hook).
+type DeviceRecord struct {
+	DevicePath string      `json:"device-path,omitempty"`
+	Rule       *DeviceRule `json:"rule,omitempty"`
+	Major      int64       `json:"major,omitempty"`
+	Minor      int64       `json:"minor,omitempty"`
+	// Driver is the host driver a VFIO/PCI device was bound to before
+	// being attached (e.g. "vfio-pci"). Replaying the record must rebind
+	// the same driver, or the re-attach loses the passthrough override
+	// the original attach asked for.
+	Driver      string    `json:"driver,omitempty"`
+	Permissions string    `json:"permissions,omitempty"`
+	AttachedAt  time.Time `json:"attached-at"`
+}
+
+// DeviceStorePath returns the path of the persisted device record file
+// for the sandbox identified by sandboxID.
+func DeviceStorePath(sandboxID string) string {
+	return filepath.Join(sandboxStateDirRoot, sandboxID, deviceStoreFile)
+}
+
+// LoadDeviceRecords reads the persisted device records for sandboxID. A
+// missing store is not an error: it simply means no device has been
+// durably attached yet.
+func LoadDeviceRecords(sandboxID string) ([]DeviceRecord, error) {
+	data, err := os.ReadFile(DeviceStorePath(sandboxID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error reading device records: %w", err)
+	}
+
+	var records []DeviceRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("error parsing device records: %w", err)
+	}
+
+	return records, nil
+}
+
+// SaveDeviceRecords persists records for sandboxID, replacing whatever
+// was stored before. The new contents are written to a temporary file
+// in the same directory and renamed into place, so a reader never
+// observes a partially written store.
+func SaveDeviceRecords(sandboxID string, records []DeviceRecord) error {
+	path := DeviceStorePath(sandboxID)
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return fmt.Errorf("error creating device store directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshalling device records: %w", err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0640); err != nil {
+		return fmt.Errorf("error writing device records: %w", err)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("error committing device records: %w", err)
+	}
+
+	return nil
+}
+
+// AddDeviceRecord appends record to the persisted store for sandboxID.
+func AddDeviceRecord(sandboxID string, record DeviceRecord) error {
+	records, err := LoadDeviceRecords(sandboxID)
+	if err != nil {
+		return err
+	}
+
+	records = append(records, record)
+	return SaveDeviceRecords(sandboxID, records)
+}
+
+// RemoveDeviceRecord drops every persisted record matching devicePath
+// and rule from sandboxID's store. Both are compared exactly as they were
+// supplied to the attach that created the record.
+func RemoveDeviceRecord(sandboxID, devicePath string, rule *DeviceRule) error {
+	records, err := LoadDeviceRecords(sandboxID)
+	if err != nil {
+		return err
+	}
+
+	kept := records[:0]
+	for _, record := range records {
+		if record.DevicePath == devicePath && deviceRulesEqual(record.Rule, rule) {
+			continue
+		}
+		kept = append(kept, record)
+	}
+
+	return SaveDeviceRecords(sandboxID, kept)
+}
+
+// ReconcileDeviceRecords compares the persisted device records for
+// sandboxID against what the sandbox currently reports attached —
+// concrete device nodes (actual) and programmed device cgroup rules
+// (programmedRules) — and returns the records that are missing and
+// therefore need to be re-attached, e.g. because the guest kernel lost
+// a hot-plugged device across a suspend/resume. A rule-based record is
+// checked against programmedRules, not actual: a pure permission grant
+// such as "c 226:* rwm" never appears as a concrete device node, so
+// matching it against actual would report it as permanently missing.
+func ReconcileDeviceRecords(sandboxID string, actual []config.DeviceInfo, programmedRules []DeviceRule) ([]DeviceRecord, error) {
+	records, err := LoadDeviceRecords(sandboxID)
+	if err != nil {
+		return nil, err
+	}
+
+	var missing []DeviceRecord
+	for _, record := range records {
+		if !deviceRecordPresent(record, actual, programmedRules) {
+			missing = append(missing, record)
+		}
+	}
+
+	return missing, nil
+}
+
+// ReplayDeviceRecords reconciles the persisted device records for
+// sandboxID against actual and programmedRules, then calls attach once
+// for every record ReconcileDeviceRecords reports missing, in the order
+// the records were persisted. It returns the records it replayed
+// successfully; on an attach error it returns that error alongside
+// whatever had already replayed, so the caller can report partial
+// progress rather than losing it.
+//
+// This is the single entry point a sandbox start/restart path should
+// call to restore devices lost across a guest suspend/resume or a shim
+// restart — see the DeviceRecord doc comment for why nothing in this
+// package calls it automatically today.
+func ReplayDeviceRecords(sandboxID string, actual []config.DeviceInfo, programmedRules []DeviceRule, attach func(DeviceRecord) error) ([]DeviceRecord, error) {
+	missing, err := ReconcileDeviceRecords(sandboxID, actual, programmedRules)
+	if err != nil {
+		return nil, err
+	}
+
+	var replayed []DeviceRecord
+	for _, record := range missing {
+		if err := attach(record); err != nil {
+			return replayed, err
+		}
+		replayed = append(replayed, record)
+	}
+
+	return replayed, nil
+}
+
+func deviceRecordPresent(record DeviceRecord, actual []config.DeviceInfo, programmedRules []DeviceRule) bool {
+	if record.Rule != nil {
+		for _, rule := range programmedRules {
+			if deviceRulesEqual(record.Rule, &rule) {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, dev := range actual {
+		if dev.ContainerPath == record.DevicePath {
+			return true
+		}
+	}
+
+	return false
+}
+
+func deviceRulesEqual(a, b *DeviceRule) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+
+	return a.Type == b.Type &&
+		a.Permissions == b.Permissions &&
+		a.Allow == b.Allow &&
+		int64PtrEqual(a.Major, b.Major) &&
+		int64PtrEqual(a.Minor, b.Minor)
+}
+
+func int64PtrEqual(a, b *int64) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+
+	return *a == *b
+}
@@ -0,0 +1,192 @@
+// Copyright (c) 2023 Kata Contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package katautils
+
+import (
+	"testing"
+
+	"github.com/kata-containers/kata-containers/src/runtime/pkg/device/config"
+)
+
+// withTempStateDir points sandboxStateDirRoot at a temp directory for the
+// duration of the test, so the device store round-trips through real
+// file I/O without touching /run/vc/sbs.
+func withTempStateDir(t *testing.T) {
+	t.Helper()
+
+	previous := sandboxStateDirRoot
+	sandboxStateDirRoot = t.TempDir()
+	t.Cleanup(func() { sandboxStateDirRoot = previous })
+}
+
+func TestAddDeviceRecordPersistsAcrossLoads(t *testing.T) {
+	withTempStateDir(t)
+
+	record := DeviceRecord{DevicePath: "/dev/null", Major: 1, Minor: 3}
+	if err := AddDeviceRecord("sandbox1", record); err != nil {
+		t.Fatalf("AddDeviceRecord() error = %v", err)
+	}
+
+	records, err := LoadDeviceRecords("sandbox1")
+	if err != nil {
+		t.Fatalf("LoadDeviceRecords() error = %v", err)
+	}
+
+	if len(records) != 1 || records[0].DevicePath != record.DevicePath {
+		t.Fatalf("LoadDeviceRecords() = %+v, want a single record for %q", records, record.DevicePath)
+	}
+}
+
+func TestLoadDeviceRecordsMissingStoreIsNotAnError(t *testing.T) {
+	withTempStateDir(t)
+
+	records, err := LoadDeviceRecords("no-such-sandbox")
+	if err != nil {
+		t.Fatalf("LoadDeviceRecords() error = %v", err)
+	}
+
+	if records != nil {
+		t.Errorf("LoadDeviceRecords() = %+v, want nil for a sandbox with no store", records)
+	}
+}
+
+func TestRemoveDeviceRecordDropsOnlyTheMatchingRecord(t *testing.T) {
+	withTempStateDir(t)
+
+	pathRecord := DeviceRecord{DevicePath: "/dev/null"}
+	ruleRecord := DeviceRecord{Rule: &DeviceRule{Type: charDevice, Major: int64Ptr(226)}}
+
+	if err := AddDeviceRecord("sandbox1", pathRecord); err != nil {
+		t.Fatalf("AddDeviceRecord() error = %v", err)
+	}
+	if err := AddDeviceRecord("sandbox1", ruleRecord); err != nil {
+		t.Fatalf("AddDeviceRecord() error = %v", err)
+	}
+
+	if err := RemoveDeviceRecord("sandbox1", "/dev/null", nil); err != nil {
+		t.Fatalf("RemoveDeviceRecord() error = %v", err)
+	}
+
+	records, err := LoadDeviceRecords("sandbox1")
+	if err != nil {
+		t.Fatalf("LoadDeviceRecords() error = %v", err)
+	}
+
+	if len(records) != 1 || records[0].Rule == nil {
+		t.Fatalf("LoadDeviceRecords() = %+v, want only the rule record to remain", records)
+	}
+}
+
+func TestReconcileDeviceRecordsPathBasedRecord(t *testing.T) {
+	withTempStateDir(t)
+
+	if err := AddDeviceRecord("sandbox1", DeviceRecord{DevicePath: "/dev/null"}); err != nil {
+		t.Fatalf("AddDeviceRecord() error = %v", err)
+	}
+
+	missing, err := ReconcileDeviceRecords("sandbox1", nil, nil)
+	if err != nil {
+		t.Fatalf("ReconcileDeviceRecords() error = %v", err)
+	}
+	if len(missing) != 1 {
+		t.Fatalf("ReconcileDeviceRecords() = %+v, want the record reported missing when no devices are live", missing)
+	}
+
+	missing, err = ReconcileDeviceRecords("sandbox1", []config.DeviceInfo{{ContainerPath: "/dev/null"}}, nil)
+	if err != nil {
+		t.Fatalf("ReconcileDeviceRecords() error = %v", err)
+	}
+	if len(missing) != 0 {
+		t.Fatalf("ReconcileDeviceRecords() = %+v, want no drift once the device is live", missing)
+	}
+}
+
+func TestReconcileDeviceRecordsRuleBasedRecordIgnoresDeviceNodes(t *testing.T) {
+	withTempStateDir(t)
+
+	rule := DeviceRule{Type: charDevice, Major: int64Ptr(226), Permissions: "rwm"}
+	if err := AddDeviceRecord("sandbox1", DeviceRecord{Rule: &rule}); err != nil {
+		t.Fatalf("AddDeviceRecord() error = %v", err)
+	}
+
+	// A concrete device node matching the rule is not the same thing as
+	// the cgroup rule being programmed: a pure permission grant never
+	// shows up as a device node, so it must not be judged against actual.
+	actual := []config.DeviceInfo{{DevType: charDevice, Major: 226, Minor: 0}}
+
+	missing, err := ReconcileDeviceRecords("sandbox1", actual, nil)
+	if err != nil {
+		t.Fatalf("ReconcileDeviceRecords() error = %v", err)
+	}
+	if len(missing) != 1 {
+		t.Fatalf("ReconcileDeviceRecords() = %+v, want the rule reported missing until it shows up in programmedRules", missing)
+	}
+
+	missing, err = ReconcileDeviceRecords("sandbox1", nil, []DeviceRule{rule})
+	if err != nil {
+		t.Fatalf("ReconcileDeviceRecords() error = %v", err)
+	}
+	if len(missing) != 0 {
+		t.Fatalf("ReconcileDeviceRecords() = %+v, want no drift once the rule is programmed", missing)
+	}
+}
+
+func TestReplayDeviceRecordsOnlyAttachesWhatIsMissing(t *testing.T) {
+	withTempStateDir(t)
+
+	present := DeviceRecord{DevicePath: "/dev/null"}
+	missing := DeviceRecord{DevicePath: "/dev/zero"}
+
+	if err := AddDeviceRecord("sandbox1", present); err != nil {
+		t.Fatalf("AddDeviceRecord() error = %v", err)
+	}
+	if err := AddDeviceRecord("sandbox1", missing); err != nil {
+		t.Fatalf("AddDeviceRecord() error = %v", err)
+	}
+
+	actual := []config.DeviceInfo{{ContainerPath: present.DevicePath}}
+
+	var attached []string
+	replayed, err := ReplayDeviceRecords("sandbox1", actual, nil, func(record DeviceRecord) error {
+		attached = append(attached, record.DevicePath)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ReplayDeviceRecords() error = %v", err)
+	}
+
+	if len(attached) != 1 || attached[0] != missing.DevicePath {
+		t.Fatalf("attach calls = %v, want exactly one call for %q", attached, missing.DevicePath)
+	}
+	if len(replayed) != 1 || replayed[0].DevicePath != missing.DevicePath {
+		t.Fatalf("ReplayDeviceRecords() = %+v, want only %q replayed", replayed, missing.DevicePath)
+	}
+}
+
+func TestReplayDeviceRecordsStopsOnAttachError(t *testing.T) {
+	withTempStateDir(t)
+
+	errBoom := errAttachFailed{}
+
+	if err := AddDeviceRecord("sandbox1", DeviceRecord{DevicePath: "/dev/zero"}); err != nil {
+		t.Fatalf("AddDeviceRecord() error = %v", err)
+	}
+
+	replayed, err := ReplayDeviceRecords("sandbox1", nil, nil, func(record DeviceRecord) error {
+		return errBoom
+	})
+
+	if err != errBoom {
+		t.Fatalf("ReplayDeviceRecords() error = %v, want %v", err, errBoom)
+	}
+	if len(replayed) != 0 {
+		t.Errorf("ReplayDeviceRecords() = %+v, want no records reported replayed when attach fails", replayed)
+	}
+}
+
+type errAttachFailed struct{}
+
+func (errAttachFailed) Error() string { return "attach failed" }
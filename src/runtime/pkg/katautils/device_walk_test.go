@@ -0,0 +1,60 @@
+// Copyright (c) 2023 Kata Contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package katautils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// requireRoot skips the test when it cannot create device nodes, which
+// mknod(2) restricts to a privileged caller.
+func requireRoot(t *testing.T) {
+	t.Helper()
+
+	if os.Geteuid() != 0 {
+		t.Skip("creating device nodes requires root")
+	}
+}
+
+func TestGetDeviceInfoByPathDirectorySkipsNonDeviceEntries(t *testing.T) {
+	requireRoot(t)
+
+	dir := t.TempDir()
+
+	charPath := filepath.Join(dir, "char0")
+	if err := unix.Mknod(charPath, unix.S_IFCHR|0600, int(unix.Mkdev(1, 3))); err != nil {
+		t.Fatalf("failed to create char device node: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "not-a-device"), []byte("hello"), 0600); err != nil {
+		t.Fatalf("failed to create regular file: %v", err)
+	}
+
+	if err := os.Mkdir(filepath.Join(dir, "subdir"), 0700); err != nil {
+		t.Fatalf("failed to create subdirectory: %v", err)
+	}
+
+	devices, err := GetDeviceInfoByPath(dir)
+	if err != nil {
+		t.Fatalf("GetDeviceInfoByPath() error = %v", err)
+	}
+
+	if len(devices) != 1 {
+		t.Fatalf("GetDeviceInfoByPath() returned %d devices, want 1: %+v", len(devices), devices)
+	}
+
+	if devices[0].ContainerPath != charPath {
+		t.Errorf("ContainerPath = %q, want %q", devices[0].ContainerPath, charPath)
+	}
+
+	if devices[0].DevType != charDevice {
+		t.Errorf("DevType = %q, want %q", devices[0].DevType, charDevice)
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"strings"
 	"syscall"
 
 	"golang.org/x/sys/unix"
@@ -135,34 +136,161 @@ func VerifyContainerID(id string) error {
 	return nil
 }
 
-func GetDeviceInfoByPath(devPath string) (config.DeviceInfo, error) {
-	var devInfo config.DeviceInfo
+// GetDeviceInfoByPath resolves devPath to the device node(s) it refers to.
+// If devPath is a directory, it is walked recursively and every
+// block/char/fifo node found beneath it is returned, preserving each
+// node's original container path; non-device entries are skipped. This
+// mirrors the semantics docker/podman use for directory device requests
+// such as `--device /dev/dri`.
+func GetDeviceInfoByPath(devPath string) ([]config.DeviceInfo, error) {
+	// A PCI device's sysfs directory is, as the name implies, a
+	// directory, but it identifies a single passthrough device rather
+	// than a subtree to walk.
+	if pciAddressRegex.MatchString(devPath) {
+		dev, err := DeviceFromPath(devPath)
+		if err != nil {
+			return nil, err
+		}
+		return []config.DeviceInfo{*dev}, nil
+	}
+
 	stat, err := os.Stat(devPath)
 	if err != nil {
-		return devInfo, fmt.Errorf("error stating device path: %w", err)
+		return nil, fmt.Errorf("error stating device path: %w", err)
 	}
 
 	if !stat.IsDir() {
 		dev, err := DeviceFromPath(devPath)
 		if err != nil {
-			return devInfo, err
+			return nil, err
 		}
-		return *dev, nil
+		return []config.DeviceInfo{*dev}, nil
+	}
+
+	// os.Stat above follows symlinks, so devPath itself may be a symlink
+	// to the directory we just confirmed exists. filepath.Walk lstats its
+	// root and refuses to descend into a symlink, which would otherwise
+	// make this silently return no devices; resolve it first so the walk
+	// actually sees a directory.
+	walkPath, err := filepath.EvalSymlinks(devPath)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving device path %q: %w", devPath, err)
 	}
 
-	return devInfo, nil
+	var devices []config.DeviceInfo
+	err = filepath.Walk(walkPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+
+		dev, err := DeviceFromPath(path)
+		if err != nil {
+			if errors.Is(err, errNotADeviceNode) {
+				// Not a device node (e.g. a regular file mixed into
+				// the directory); skip it rather than failing the
+				// whole walk.
+				return nil
+			}
+			return fmt.Errorf("error inspecting %q: %w", path, err)
+		}
+
+		// Report the node beneath devPath as given, not beneath the
+		// resolved walkPath, so a symlinked directory keeps its paths.
+		rel, err := filepath.Rel(walkPath, path)
+		if err != nil {
+			return fmt.Errorf("error relativising %q: %w", path, err)
+		}
+		dev.ContainerPath = filepath.Join(devPath, rel)
+
+		devices = append(devices, *dev)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error walking device path %q: %w", devPath, err)
+	}
+
+	return devices, nil
 }
 
 const (
-	wildcardDevice = "a" //nolint // currently unused, but should be included when upstreaming to OCI runtime-spec.
+	wildcardDevice = "a"
 	blockDevice    = "b"
 	charDevice     = "c" // or "u"
 	fifoDevice     = "p"
+	vfioDevice     = "vfio"
+	pciDevice      = "pci"
 )
 
+// vfioGroupRegex matches a VFIO group device node, e.g. /dev/vfio/42.
+var vfioGroupRegex = regexp.MustCompile(`^/dev/vfio/(\d+)$`)
+
+// pciAddressRegex matches a PCI device's sysfs directory, e.g.
+// /sys/bus/pci/devices/0000:03:00.0.
+var pciAddressRegex = regexp.MustCompile(`^/sys/bus/pci/devices/([0-9a-fA-F]{4}:[0-9a-fA-F]{2}:[0-9a-fA-F]{2}\.[0-9a-fA-F])$`)
+
+// DeviceRule describes an OCI Linux device cgroup rule: a pattern that may
+// cover more than one concrete device node, mirroring runc's
+// libcontainer/devices Rule. A nil Major or Minor means "any" (the OCI
+// wildcard "*").
+type DeviceRule struct {
+	// Type is one of wildcardDevice ("a"), blockDevice ("b") or
+	// charDevice ("c").
+	Type string `json:"type"`
+	// Major and Minor are nil when the rule should match any major or
+	// minor number respectively.
+	Major *int64 `json:"major,omitempty"`
+	Minor *int64 `json:"minor,omitempty"`
+	// Permissions is the cgroup access mask, e.g. "rwm".
+	Permissions string `json:"permissions,omitempty"`
+	// Allow indicates whether matching accesses are allowed or denied.
+	Allow bool `json:"allow"`
+}
+
+// Matches reports whether rule covers the device described by dev.
+func (rule DeviceRule) Matches(dev config.DeviceInfo) bool {
+	if rule.Type != wildcardDevice && rule.Type != dev.DevType {
+		return false
+	}
+
+	if rule.Major != nil && *rule.Major != dev.Major {
+		return false
+	}
+
+	if rule.Minor != nil && *rule.Minor != dev.Minor {
+		return false
+	}
+
+	return true
+}
+
+// errNotADeviceNode is returned by DeviceFromPath when path exists but
+// names a regular file, directory or other non-device entry, so callers
+// walking a directory can tell that apart from a genuine stat failure.
+var errNotADeviceNode = errors.New("not a device node")
+
 // DeviceFromPath takes the path to a device to look up the information about a
 // linux device and returns that information as a config.DeviceInfo struct.
+// In addition to block/char/fifo nodes, it recognises a VFIO group device
+// (/dev/vfio/<group>) or a PCI device's sysfs directory
+// (/sys/bus/pci/devices/<bdf>), returning a config.DeviceInfo describing
+// the VFIO/PCI passthrough device instead.
 func DeviceFromPath(path string) (*config.DeviceInfo, error) {
+	if m := vfioGroupRegex.FindStringSubmatch(path); m != nil {
+		return &config.DeviceInfo{
+			ContainerPath: path,
+			DevType:       vfioDevice,
+			IOMMUGroup:    m[1],
+		}, nil
+	}
+
+	if m := pciAddressRegex.FindStringSubmatch(path); m != nil {
+		return deviceFromPCIPath(path, m[1])
+	}
+
 	var stat unix.Stat_t
 	if err := unix.Lstat(path, &stat); err != nil {
 		return nil, err
@@ -187,7 +315,7 @@ func DeviceFromPath(path string) (*config.DeviceInfo, error) {
 	case unix.S_IFIFO:
 		devType = fifoDevice
 	default:
-		return nil, fmt.Errorf("not a device node")
+		return nil, errNotADeviceNode
 	}
 	fm := os.FileMode(mode &^ unix.S_IFMT)
 
@@ -203,3 +331,36 @@ func DeviceFromPath(path string) (*config.DeviceInfo, error) {
 
 	return deviceInfo, nil
 }
+
+// deviceFromPCIPath builds the config.DeviceInfo for a PCI device located
+// at its sysfs directory, reading the vendor/device ID and bound driver
+// (if any) alongside the BDF itself.
+func deviceFromPCIPath(path, bdf string) (*config.DeviceInfo, error) {
+	deviceInfo := &config.DeviceInfo{
+		ContainerPath: path,
+		DevType:       pciDevice,
+		BDF:           bdf,
+	}
+
+	vendorID, err := GetFileContents(filepath.Join(path, "vendor"))
+	if err != nil {
+		return nil, fmt.Errorf("error reading PCI vendor ID for %q: %w", bdf, err)
+	}
+	deviceInfo.VendorID = strings.TrimPrefix(strings.TrimSpace(vendorID), "0x")
+
+	deviceID, err := GetFileContents(filepath.Join(path, "device"))
+	if err != nil {
+		return nil, fmt.Errorf("error reading PCI device ID for %q: %w", bdf, err)
+	}
+	deviceInfo.DeviceID = strings.TrimPrefix(strings.TrimSpace(deviceID), "0x")
+
+	if driverPath, err := filepath.EvalSymlinks(filepath.Join(path, "driver")); err == nil {
+		deviceInfo.Driver = filepath.Base(driverPath)
+	}
+
+	if groupPath, err := filepath.EvalSymlinks(filepath.Join(path, "iommu_group")); err == nil {
+		deviceInfo.IOMMUGroup = filepath.Base(groupPath)
+	}
+
+	return deviceInfo, nil
+}